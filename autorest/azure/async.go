@@ -0,0 +1,214 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/azure/go-autorest/autorest"
+)
+
+const (
+	headerAsyncOperation = "Azure-AsyncOperation"
+	headerLocation       = "Location"
+	headerRetryAfter     = "Retry-After"
+
+	statusSucceeded = "Succeeded"
+	statusFailed    = "Failed"
+	statusCanceled  = "Canceled"
+)
+
+// cancelKey is the context key under which WithPollCancel stores the cancel channel carried on
+// an *http.Request, allowing DoPollForAsynchronous to retrieve it and callers to abort a poll by
+// closing it.
+type cancelKey struct{}
+
+// operationResource models the subset of an Azure async operation resource this package cares
+// about: its status (or provisioning state) and, on failure, the error envelope.
+type operationResource struct {
+	Status            string `json:"status"`
+	ProvisioningState string `json:"provisioningState"`
+	Error             *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (o operationResource) state() string {
+	if o.Status != "" {
+		return o.Status
+	}
+	return o.ProvisioningState
+}
+
+// WithPollCancel attaches a cancel channel to the request. Closing done aborts any in-progress
+// DoPollForAsynchronous polling of the response to this request.
+func WithPollCancel(r *http.Request, done <-chan struct{}) *http.Request {
+	return r.WithContext(withCancelChannel(r.Context(), done))
+}
+
+func withCancelChannel(ctx context.Context, done <-chan struct{}) context.Context {
+	return context.WithValue(ctx, cancelKey{}, done)
+}
+
+func cancelChannel(ctx context.Context) <-chan struct{} {
+	done, _ := ctx.Value(cancelKey{}).(<-chan struct{})
+	return done
+}
+
+// DoPollForAsynchronous returns a SendDecorator that polls if the initial response indicates a
+// long-running Azure operation was accepted (a 201 or 202, or a 200 to a PUT/PATCH carrying a
+// provisioning state). The delay is used between polls unless the response carries a
+// Retry-After header.
+func DoPollForAsynchronous(delay time.Duration) autorest.SendDecorator {
+	return func(s autorest.Sender) autorest.Sender {
+		return autorest.SenderFunc(func(r *http.Request) (*http.Response, error) {
+			resp, err := s.Do(r)
+			if err != nil {
+				return resp, err
+			}
+
+			if !isAsyncResponse(r, resp) {
+				return resp, nil
+			}
+			drainAndClose(resp)
+
+			done := cancelChannel(r.Context())
+			url := pollURL(r, resp)
+			pollResp := resp
+
+			for {
+				o, newPollResp, pollErr := getOperationResource(s, r, url)
+				if pollErr != nil {
+					return resp, pollErr
+				}
+				pollResp = newPollResp
+
+				switch o.state() {
+				case statusSucceeded:
+					return finalGetResponse(s, r, resp)
+				case statusFailed, statusCanceled:
+					return resp, operationError(o)
+				}
+
+				wait := delay
+				if ra := pollResp.Header.Get(headerRetryAfter); ra != "" {
+					if s, err := strconv.Atoi(ra); err == nil {
+						wait = time.Duration(s) * time.Second
+					}
+				}
+
+				select {
+				case <-time.After(wait):
+				case <-done:
+					return resp, fmt.Errorf("azure: polling of %s was cancelled", r.URL)
+				}
+			}
+		})
+	}
+}
+
+func isAsyncResponse(r *http.Request, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusCreated, http.StatusAccepted:
+		return true
+	case http.StatusOK:
+		if (r.Method != http.MethodPut && r.Method != http.MethodPatch) || resp.Body == nil {
+			return false
+		}
+		// Read the body to look for a provisioning state, then restore it so that a response
+		// which is not polled reaches the caller unread.
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+		var o operationResource
+		return json.Unmarshal(body, &o) == nil && o.ProvisioningState != ""
+	}
+	return false
+}
+
+func pollURL(r *http.Request, resp *http.Response) string {
+	if u := resp.Header.Get(headerAsyncOperation); u != "" {
+		return u
+	}
+	if u := resp.Header.Get(headerLocation); u != "" {
+		return u
+	}
+	return r.URL.String()
+}
+
+func getOperationResource(s autorest.Sender, r *http.Request, url string) (*operationResource, *http.Response, error) {
+	req, err := newPollRequest(r, url)
+	if err != nil {
+		return nil, nil, fmt.Errorf("azure: Failed to create polling request for %s (%v)", url, err)
+	}
+
+	resp, err := s.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("azure: Polling request to %s failed (%v)", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp, fmt.Errorf("azure: Failed to read polling response from %s (%v)", url, err)
+	}
+
+	o := &operationResource{}
+	if err := json.Unmarshal(body, o); err != nil {
+		return nil, resp, fmt.Errorf("azure: Failed to unmarshal polling response from %s (%v)", url, err)
+	}
+	return o, resp, nil
+}
+
+// drainAndClose drains and closes resp.Body so the underlying connection can be reused, without
+// surfacing an error for a response the caller has already decided not to read.
+func drainAndClose(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+func finalGetResponse(s autorest.Sender, r *http.Request, resp *http.Response) (*http.Response, error) {
+	req, err := newPollRequest(r, r.URL.String())
+	if err != nil {
+		return resp, fmt.Errorf("azure: Failed to create final polling request for %s (%v)", r.URL, err)
+	}
+	final, err := s.Do(req)
+	if err != nil {
+		return resp, fmt.Errorf("azure: Final polling request to %s failed (%v)", r.URL, err)
+	}
+	return final, nil
+}
+
+// newPollRequest builds a GET request against url, carrying the headers of the original request
+// r. Poll and final requests hit the same service as the original request and so must present
+// the same Authorization (and any other) headers to avoid being rejected.
+func newPollRequest(r *http.Request, url string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+func operationError(o *operationResource) error {
+	if o.Error != nil {
+		return fmt.Errorf("azure: Long running operation failed with status %q (%s: %s)", o.state(), o.Error.Code, o.Error.Message)
+	}
+	return fmt.Errorf("azure: Long running operation failed with status %q", o.state())
+}
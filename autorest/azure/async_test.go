@@ -0,0 +1,175 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azure/go-autorest/autorest"
+)
+
+// testSender routes requests to a func, standing in for the autorest.Sender that would normally
+// carry a request to the real http.Client.
+type testSender func(*http.Request) (*http.Response, error)
+
+func (s testSender) Do(r *http.Request) (*http.Response, error) { return s(r) }
+
+func newBodyResponse(statusCode int, headers http.Header, body string) *http.Response {
+	rec := httptest.NewRecorder()
+	rec.WriteHeader(statusCode)
+	rec.WriteString(body)
+	resp := rec.Result()
+	for k, v := range headers {
+		resp.Header[k] = v
+	}
+	return resp
+}
+
+func operationBody(status string) string {
+	b, _ := json.Marshal(operationResource{Status: status})
+	return string(b)
+}
+
+func TestDoPollForAsynchronous_PropagatesHeadersToPollAndFinalRequests(t *testing.T) {
+	var pollAuth, finalAuth string
+	calls := 0
+	sender := testSender(func(r *http.Request) (*http.Response, error) {
+		calls++
+		switch calls {
+		case 1:
+			return newBodyResponse(http.StatusAccepted, http.Header{headerLocation: {"https://management.azure.com/poll"}}, ""), nil
+		case 2:
+			pollAuth = r.Header.Get("Authorization")
+			return newBodyResponse(http.StatusOK, nil, operationBody(statusSucceeded)), nil
+		case 3:
+			finalAuth = r.Header.Get("Authorization")
+			return newBodyResponse(http.StatusOK, nil, `{"result":"done"}`), nil
+		}
+		return nil, fmt.Errorf("unexpected call %d", calls)
+	})
+
+	req, err := http.NewRequest(http.MethodPut, "https://management.azure.com/resource", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secret-token")
+
+	s := DoPollForAsynchronous(time.Millisecond)(sender)
+	if _, err := s.Do(req); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+
+	if pollAuth != "Bearer secret-token" {
+		t.Errorf("poll request Authorization = %q, want %q", pollAuth, "Bearer secret-token")
+	}
+	if finalAuth != "Bearer secret-token" {
+		t.Errorf("final request Authorization = %q, want %q", finalAuth, "Bearer secret-token")
+	}
+}
+
+func TestDoPollForAsynchronous_HonorsRetryAfter(t *testing.T) {
+	calls := 0
+	sender := testSender(func(r *http.Request) (*http.Response, error) {
+		calls++
+		switch calls {
+		case 1:
+			return newBodyResponse(http.StatusAccepted, http.Header{headerLocation: {"https://management.azure.com/poll"}}, ""), nil
+		case 2:
+			return newBodyResponse(http.StatusOK, http.Header{headerRetryAfter: {"0"}}, operationBody("InProgress")), nil
+		case 3:
+			return newBodyResponse(http.StatusOK, nil, operationBody(statusSucceeded)), nil
+		case 4:
+			return newBodyResponse(http.StatusOK, nil, `{}`), nil
+		}
+		return nil, fmt.Errorf("unexpected call %d", calls)
+	})
+
+	req, err := http.NewRequest(http.MethodPut, "https://management.azure.com/resource", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	s := DoPollForAsynchronous(10 * time.Second)(sender)
+	if _, err := s.Do(req); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("polling took %v, want well under the 10s default delay (Retry-After: 0 should have been honored)", elapsed)
+	}
+}
+
+func TestDoPollForAsynchronous_TerminalStates(t *testing.T) {
+	cases := []struct {
+		status  string
+		wantErr bool
+	}{
+		{statusSucceeded, false},
+		{statusFailed, true},
+		{statusCanceled, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.status, func(t *testing.T) {
+			calls := 0
+			sender := testSender(func(r *http.Request) (*http.Response, error) {
+				calls++
+				if calls == 1 {
+					return newBodyResponse(http.StatusAccepted, http.Header{headerLocation: {"https://management.azure.com/poll"}}, ""), nil
+				}
+				if calls == 2 {
+					return newBodyResponse(http.StatusOK, nil, operationBody(c.status)), nil
+				}
+				return newBodyResponse(http.StatusOK, nil, `{}`), nil
+			})
+
+			req, err := http.NewRequest(http.MethodPut, "https://management.azure.com/resource", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := DoPollForAsynchronous(time.Millisecond)(sender)
+			_, err = s.Do(req)
+			if c.wantErr && err == nil {
+				t.Fatalf("expected an error for terminal status %q, got nil", c.status)
+			}
+			if !c.wantErr && err != nil {
+				t.Fatalf("expected no error for terminal status %q, got %v", c.status, err)
+			}
+		})
+	}
+}
+
+func TestDoPollForAsynchronous_CancelledByWithPollCancel(t *testing.T) {
+	calls := 0
+	sender := testSender(func(r *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			return newBodyResponse(http.StatusAccepted, http.Header{headerLocation: {"https://management.azure.com/poll"}}, ""), nil
+		}
+		return newBodyResponse(http.StatusOK, nil, operationBody("InProgress")), nil
+	})
+
+	req, err := http.NewRequest(http.MethodPut, "https://management.azure.com/resource", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	req = WithPollCancel(req, done)
+	close(done)
+
+	s := DoPollForAsynchronous(time.Minute)(sender)
+	_, err = s.Do(req)
+	if err == nil {
+		t.Fatal("expected an error from a cancelled poll, got nil")
+	}
+	if !strings.Contains(err.Error(), "cancelled") {
+		t.Errorf("expected a cancellation error, got %v", err)
+	}
+}
+
+var _ autorest.Sender = testSender(nil)
@@ -0,0 +1,128 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Environment represents a set of endpoints for each of Azure's Clouds.
+type Environment struct {
+	Name                       string `json:"name"`
+	ActiveDirectoryEndpoint    string `json:"activeDirectoryEndpoint"`
+	ResourceManagerEndpoint    string `json:"resourceManagerEndpoint"`
+	GalleryEndpoint            string `json:"galleryEndpoint"`
+	GraphEndpoint              string `json:"graphEndpoint"`
+	KeyVaultEndpoint           string `json:"keyVaultEndpoint"`
+	StorageEndpointSuffix      string `json:"storageEndpointSuffix"`
+	SQLDatabaseDNSSuffix       string `json:"sqlDatabaseDNSSuffix"`
+	TrafficManagerDNSSuffix    string `json:"trafficManagerDNSSuffix"`
+	KeyVaultDNSSuffix          string `json:"keyVaultDNSSuffix"`
+	ServiceBusEndpointSuffix   string `json:"serviceBusEndpointSuffix"`
+	ContainerRegistryDNSSuffix string `json:"containerRegistryDNSSuffix"`
+}
+
+var (
+	// PublicCloud is the default, public Azure cloud environment.
+	PublicCloud = Environment{
+		Name:                       "AzurePublicCloud",
+		ActiveDirectoryEndpoint:    "https://login.microsoftonline.com/",
+		ResourceManagerEndpoint:    "https://management.azure.com/",
+		GalleryEndpoint:            "https://gallery.azure.com/",
+		GraphEndpoint:              "https://graph.windows.net/",
+		KeyVaultEndpoint:           "https://vault.azure.net",
+		StorageEndpointSuffix:      "core.windows.net",
+		SQLDatabaseDNSSuffix:       "database.windows.net",
+		TrafficManagerDNSSuffix:    "trafficmanager.net",
+		KeyVaultDNSSuffix:          "vault.azure.net",
+		ServiceBusEndpointSuffix:   "servicebus.windows.net",
+		ContainerRegistryDNSSuffix: "azurecr.io",
+	}
+
+	// ChinaCloud is the Azure China cloud environment.
+	ChinaCloud = Environment{
+		Name:                       "AzureChinaCloud",
+		ActiveDirectoryEndpoint:    "https://login.chinacloudapi.cn/",
+		ResourceManagerEndpoint:    "https://management.chinacloudapi.cn/",
+		GalleryEndpoint:            "https://gallery.chinacloudapi.cn/",
+		GraphEndpoint:              "https://graph.chinacloudapi.cn/",
+		KeyVaultEndpoint:           "https://vault.azure.cn",
+		StorageEndpointSuffix:      "core.chinacloudapi.cn",
+		SQLDatabaseDNSSuffix:       "database.chinacloudapi.cn",
+		TrafficManagerDNSSuffix:    "trafficmanager.cn",
+		KeyVaultDNSSuffix:          "vault.azure.cn",
+		ServiceBusEndpointSuffix:   "servicebus.chinacloudapi.cn",
+		ContainerRegistryDNSSuffix: "azurecr.cn",
+	}
+
+	// USGovernmentCloud is the Azure US Government cloud environment.
+	USGovernmentCloud = Environment{
+		Name:                       "AzureUSGovernmentCloud",
+		ActiveDirectoryEndpoint:    "https://login.microsoftonline.us/",
+		ResourceManagerEndpoint:    "https://management.usgovcloudapi.net/",
+		GalleryEndpoint:            "https://gallery.usgovcloudapi.net/",
+		GraphEndpoint:              "https://graph.windows.net/",
+		KeyVaultEndpoint:           "https://vault.usgovcloudapi.net",
+		StorageEndpointSuffix:      "core.usgovcloudapi.net",
+		SQLDatabaseDNSSuffix:       "database.usgovcloudapi.net",
+		TrafficManagerDNSSuffix:    "usgovtrafficmanager.net",
+		KeyVaultDNSSuffix:          "vault.usgovcloudapi.net",
+		ServiceBusEndpointSuffix:   "servicebus.usgovcloudapi.net",
+		ContainerRegistryDNSSuffix: "azurecr.us",
+	}
+
+	// GermanCloud is the Azure Germany cloud environment.
+	GermanCloud = Environment{
+		Name:                       "AzureGermanCloud",
+		ActiveDirectoryEndpoint:    "https://login.microsoftonline.de/",
+		ResourceManagerEndpoint:    "https://management.microsoftazure.de/",
+		GalleryEndpoint:            "https://gallery.cloudapi.de/",
+		GraphEndpoint:              "https://graph.cloudapi.de/",
+		KeyVaultEndpoint:           "https://vault.microsoftazure.de",
+		StorageEndpointSuffix:      "core.cloudapi.de",
+		SQLDatabaseDNSSuffix:       "database.cloudapi.de",
+		TrafficManagerDNSSuffix:    "azurecloudapp.de",
+		KeyVaultDNSSuffix:          "vault.microsoftazure.de",
+		ServiceBusEndpointSuffix:   "servicebus.cloudapi.de",
+		ContainerRegistryDNSSuffix: "azurecr.io",
+	}
+
+	environments = map[string]Environment{
+		"AZUREPUBLICCLOUD":       PublicCloud,
+		"AZURECHINACLOUD":        ChinaCloud,
+		"AZUREUSGOVERNMENTCLOUD": USGovernmentCloud,
+		"AZUREGERMANCLOUD":       GermanCloud,
+	}
+)
+
+// OAuthConfigForTenant builds an OAuthConfig for the given tenant using this Environment's
+// active directory endpoint.
+func (env Environment) OAuthConfigForTenant(tenantID string) (*OAuthConfig, error) {
+	return NewOAuthConfig(env.ActiveDirectoryEndpoint, tenantID)
+}
+
+// EnvironmentFromName returns the Environment whose name matches the supplied name, ignoring
+// case, or an error if no such Environment is known.
+func EnvironmentFromName(name string) (Environment, error) {
+	name = strings.ToUpper(name)
+	env, ok := environments[name]
+	if !ok {
+		return env, fmt.Errorf("azure: There is no cloud environment matching the name %q", name)
+	}
+	return env, nil
+}
+
+// EnvironmentFromFile loads an Environment from a JSON file at the given path, for use with
+// Azure Stack and other private clouds that are not one of the well-known public environments.
+func EnvironmentFromFile(path string) (Environment, error) {
+	var env Environment
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return env, err
+	}
+
+	err = json.Unmarshal(data, &env)
+	return env, err
+}
@@ -0,0 +1,79 @@
+package azure
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnvironmentFromName(t *testing.T) {
+	cases := []struct {
+		name    string
+		want    Environment
+		wantErr bool
+	}{
+		{"AzurePublicCloud", PublicCloud, false},
+		{"azurepubliccloud", PublicCloud, false},
+		{"AzureChinaCloud", ChinaCloud, false},
+		{"AzureUSGovernmentCloud", USGovernmentCloud, false},
+		{"AzureGermanCloud", GermanCloud, false},
+		{"NotACloud", Environment{}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := EnvironmentFromName(c.name)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error for name %q, got nil", c.name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EnvironmentFromName(%q): %v", c.name, err)
+			}
+			if got != c.want {
+				t.Errorf("EnvironmentFromName(%q) = %+v, want %+v", c.name, got, c.want)
+			}
+		})
+	}
+}
+
+func TestEnvironmentFromFile(t *testing.T) {
+	want := Environment{
+		Name:                    "AzureStackCloud",
+		ActiveDirectoryEndpoint: "https://login.stack.example.com/",
+		ResourceManagerEndpoint: "https://management.stack.example.com/",
+	}
+
+	dir, err := ioutil.TempDir("", "environments_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "environment.json")
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := EnvironmentFromFile(path)
+	if err != nil {
+		t.Fatalf("EnvironmentFromFile: %v", err)
+	}
+	if got != want {
+		t.Errorf("EnvironmentFromFile(%q) = %+v, want %+v", path, got, want)
+	}
+}
+
+func TestEnvironmentFromFile_MissingFile(t *testing.T) {
+	if _, err := EnvironmentFromFile(filepath.Join(os.TempDir(), "does-not-exist.json")); err == nil {
+		t.Fatal("expected an error for a missing file, got nil")
+	}
+}
@@ -0,0 +1,99 @@
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/azure/go-autorest/autorest"
+)
+
+const (
+	headerRequestID = "x-ms-request-id"
+)
+
+// ServiceError encapsulates the error object as returned by an Azure resource provider, e.g.
+// {"error": {"code": ..., "message": ..., "details": [...]}}.
+type ServiceError struct {
+	Code    string                   `json:"code"`
+	Message string                   `json:"message"`
+	Details []map[string]interface{} `json:"details"`
+}
+
+func (se ServiceError) Error() string {
+	return fmt.Sprintf("%s: %s", se.Code, se.Message)
+}
+
+// RequestError describes an error response returned by an Azure resource provider, extending
+// autorest.DetailedError with the ARM error envelope and the x-ms-request-id of the failed
+// request.
+type RequestError struct {
+	autorest.DetailedError
+
+	ServiceError *ServiceError `json:"error"`
+	RequestID    string
+}
+
+// Error returns a human-friendly error message, preferring the ARM ServiceError's code and
+// message if one was present in the response body.
+func (e RequestError) Error() string {
+	if e.ServiceError != nil {
+		return fmt.Sprintf("autorest/azure: Service returned an error. Status=%v RequestId=%s %s",
+			e.StatusCode, e.RequestID, e.ServiceError)
+	}
+	return fmt.Sprintf("autorest/azure: Service returned an error. Status=%v RequestId=%s %s",
+		e.StatusCode, e.RequestID, e.Original)
+}
+
+// WithErrorUnlessStatusCode returns a RespondDecorator that, if the response StatusCode is not
+// one of the passed codes, reads the response body and attempts to unmarshal it as an Azure ARM
+// error envelope, producing a *RequestError populated from it (and from the x-ms-request-id
+// header) rather than an opaque status-code error.
+func WithErrorUnlessStatusCode(codes ...int) autorest.RespondDecorator {
+	return func(r autorest.Responder) autorest.Responder {
+		return autorest.ResponderFunc(func(resp *http.Response) error {
+			err := r.Respond(resp)
+			if containsStatusCode(codes, resp.StatusCode) {
+				return err
+			}
+
+			requestError := &RequestError{
+				DetailedError: autorest.DetailedError{
+					Original:   err,
+					StatusCode: resp.StatusCode,
+				},
+				RequestID: resp.Header.Get(headerRequestID),
+			}
+			if resp.Request != nil {
+				requestError.Method = resp.Request.Method
+				requestError.URI = resp.Request.URL.String()
+			}
+
+			body, readErr := ioutil.ReadAll(resp.Body)
+			if readErr != nil {
+				return requestError
+			}
+			resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			var envelope struct {
+				Error *ServiceError `json:"error"`
+			}
+			if jsonErr := json.Unmarshal(body, &envelope); jsonErr == nil && envelope.Error != nil {
+				requestError.ServiceError = envelope.Error
+			}
+
+			return requestError
+		})
+	}
+}
+
+func containsStatusCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
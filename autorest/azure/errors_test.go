@@ -0,0 +1,80 @@
+package azure
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/azure/go-autorest/autorest"
+)
+
+func newTestResponse(t *testing.T, statusCode int, requestID string, body string) *http.Response {
+	u, err := url.Parse("https://management.azure.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	header.Set(headerRequestID, requestID)
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Header:     header,
+		Request:    &http.Request{Method: "GET", URL: u},
+	}
+}
+
+// noopResponder stands in for the responder at the bottom of the chain that Respond would
+// normally build from the rest of a decorator list; WithErrorUnlessStatusCode is exercised in
+// isolation here, as the innermost decorator, which is how all three call sites in token.go use it.
+var noopResponder = autorest.ResponderFunc(func(*http.Response) error { return nil })
+
+func TestWithErrorUnlessStatusCode_PassesThroughExpectedStatus(t *testing.T) {
+	resp := newTestResponse(t, http.StatusOK, "", `{}`)
+	err := WithErrorUnlessStatusCode(http.StatusOK)(noopResponder).Respond(resp)
+	if err != nil {
+		t.Fatalf("expected no error for an expected status code, got %v", err)
+	}
+}
+
+func TestWithErrorUnlessStatusCode_ParsesARMErrorEnvelope(t *testing.T) {
+	body := `{"error":{"code":"InvalidClient","message":"AADSTS700016: Application not found"}}`
+	resp := newTestResponse(t, http.StatusBadRequest, "req-123", body)
+
+	err := WithErrorUnlessStatusCode(http.StatusOK)(noopResponder).Respond(resp)
+	if err == nil {
+		t.Fatal("expected an error for an unexpected status code, got nil")
+	}
+
+	reqErr, ok := err.(*RequestError)
+	if !ok {
+		t.Fatalf("expected error of type *RequestError, got %T", err)
+	}
+	if reqErr.ServiceError == nil {
+		t.Fatal("expected ServiceError to be populated from the response body")
+	}
+	if reqErr.ServiceError.Code != "InvalidClient" {
+		t.Errorf("got Code %q, want %q", reqErr.ServiceError.Code, "InvalidClient")
+	}
+	if reqErr.RequestID != "req-123" {
+		t.Errorf("got RequestID %q, want %q", reqErr.RequestID, "req-123")
+	}
+}
+
+func TestWithErrorUnlessStatusCode_UnexpectedStatusWithoutErrorEnvelope(t *testing.T) {
+	resp := newTestResponse(t, http.StatusInternalServerError, "req-456", `not json`)
+
+	err := WithErrorUnlessStatusCode(http.StatusOK)(noopResponder).Respond(resp)
+	if err == nil {
+		t.Fatal("expected an error for an unexpected status code, got nil")
+	}
+
+	reqErr, ok := err.(*RequestError)
+	if !ok {
+		t.Fatalf("expected error of type *RequestError, got %T", err)
+	}
+	if reqErr.ServiceError != nil {
+		t.Errorf("expected no ServiceError for a non-JSON body, got %v", reqErr.ServiceError)
+	}
+}
@@ -1,10 +1,21 @@
 package azure
 
 import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/azure/go-autorest/autorest"
@@ -12,8 +23,13 @@ import (
 
 const (
 	defaultRefresh = 5 * time.Minute
-	oauthUrl       = "https://login.microsoftonline.com/{tenantId}/oauth2/{requestType}?api-version=1.0"
 	tokenBaseDate  = "1970-01-01T00:00:00Z"
+
+	tokenEndpoint      = "oauth2/token"
+	authorizeEndpoint  = "oauth2/authorize"
+	deviceCodeEndpoint = "oauth2/devicecode"
+
+	msiEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
 )
 
 var expirationBase time.Time
@@ -22,9 +38,53 @@ func init() {
 	expirationBase, _ = time.Parse(time.RFC3339, tokenBaseDate)
 }
 
+// OAuthConfig represents the endpoints needed in OAuth operations against an Azure Active
+// Directory tenant.
+type OAuthConfig struct {
+	AuthorityEndpoint  url.URL
+	AuthorizeEndpoint  url.URL
+	TokenEndpoint      url.URL
+	DeviceCodeEndpoint url.URL
+}
+
+// NewOAuthConfig returns an OAuthConfig with the endpoints for the given active directory
+// endpoint and tenant ID.
+func NewOAuthConfig(activeDirectoryEndpoint, tenantID string) (*OAuthConfig, error) {
+	const api = "api-version=1.0"
+
+	u, err := url.Parse(activeDirectoryEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	authorityURL, err := u.Parse(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	authorizeURL, err := u.Parse(fmt.Sprintf("%s/%s?%s", tenantID, authorizeEndpoint, api))
+	if err != nil {
+		return nil, err
+	}
+	tokenURL, err := u.Parse(fmt.Sprintf("%s/%s?%s", tenantID, tokenEndpoint, api))
+	if err != nil {
+		return nil, err
+	}
+	deviceCodeURL, err := u.Parse(fmt.Sprintf("%s/%s?%s", tenantID, deviceCodeEndpoint, api))
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthConfig{
+		AuthorityEndpoint:  *authorityURL,
+		AuthorizeEndpoint:  *authorizeURL,
+		TokenEndpoint:      *tokenURL,
+		DeviceCodeEndpoint: *deviceCodeURL,
+	}, nil
+}
+
 // Token encapsulates the access token used to authorize Azure requests.
 type Token struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
 
 	ExpiresIn string `json:"expires_in"`
 	ExpiresOn string `json:"expires_on"`
@@ -64,81 +124,517 @@ func (t *Token) WithAuthorization() autorest.PrepareDecorator {
 	}
 }
 
+// ServicePrincipalSecret houses the behavior that distinguishes the various flows a
+// ServicePrincipalToken can authenticate with. Implementations add whatever body parameters the
+// token endpoint needs to recognize the holder of the secret.
+type ServicePrincipalSecret interface {
+	SetAuthenticationValues(spt *ServicePrincipalToken, values *url.Values) error
+}
+
+// ServicePrincipalNoSecret is used for the device code flow, where the token returned by
+// NewServicePrincipalTokenFromDeviceCode never presents a client secret to the token endpoint, on
+// the initial device code exchange or on any subsequent refresh.
+type ServicePrincipalNoSecret struct {
+}
+
+// SetAuthenticationValues is a no-op, as this flow presents no secret to the token endpoint.
+func (secret *ServicePrincipalNoSecret) SetAuthenticationValues(spt *ServicePrincipalToken, values *url.Values) error {
+	return nil
+}
+
+// ServicePrincipalTokenSecret implements ServicePrincipalSecret for client secret (password)
+// authentication, the original behavior of this package.
+type ServicePrincipalTokenSecret struct {
+	ClientSecret string
+}
+
+// SetAuthenticationValues sets the client_secret parameter used by the client credentials grant.
+func (secret *ServicePrincipalTokenSecret) SetAuthenticationValues(spt *ServicePrincipalToken, values *url.Values) error {
+	values.Set("client_secret", secret.ClientSecret)
+	return nil
+}
+
+// ServicePrincipalCertificateSecret implements ServicePrincipalSecret for certificate
+// authentication, presenting a signed JWT client assertion built from the given certificate and
+// private key.
+type ServicePrincipalCertificateSecret struct {
+	Certificate *x509.Certificate
+	PrivateKey  *rsa.PrivateKey
+}
+
+// SetAuthenticationValues adds the client_assertion_type and client_assertion parameters
+// required to authenticate via a signed JWT client assertion.
+func (secret *ServicePrincipalCertificateSecret) SetAuthenticationValues(spt *ServicePrincipalToken, values *url.Values) error {
+	assertion, err := secret.signJwt(spt)
+	if err != nil {
+		return err
+	}
+
+	values.Set("client_assertion", assertion)
+	values.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	return nil
+}
+
+func (secret *ServicePrincipalCertificateSecret) signJwt(spt *ServicePrincipalToken) (string, error) {
+	hasher := sha1.New()
+	if _, err := hasher.Write(secret.Certificate.Raw); err != nil {
+		return "", err
+	}
+	x5t := base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+
+	header, err := json.Marshal(map[string]interface{}{
+		"alg": "RS256",
+		"typ": "JWT",
+		"x5t": x5t,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	jti := make([]byte, 20)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims, err := json.Marshal(map[string]interface{}{
+		"aud": spt.oauthConfig.TokenEndpoint.String(),
+		"iss": spt.clientID,
+		"sub": spt.clientID,
+		"jti": base64.URLEncoding.EncodeToString(jti),
+		"nbf": now.Unix(),
+		"exp": now.Add(10 * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingString := fmt.Sprintf("%s.%s",
+		base64.RawURLEncoding.EncodeToString(header),
+		base64.RawURLEncoding.EncodeToString(claims))
+
+	digest := sha256.Sum256([]byte(signingString))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, secret.PrivateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s.%s", signingString, base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
+// ServicePrincipalMSISecret implements ServicePrincipalSecret for the managed identity flow.
+// The token request is a GET against the Azure Instance Metadata Service rather than a POST to
+// an AAD token endpoint, so Refresh special-cases this type rather than calling
+// SetAuthenticationValues.
+type ServicePrincipalMSISecret struct {
+}
+
+// SetAuthenticationValues is a no-op; the managed identity flow never presents a client secret.
+func (secret *ServicePrincipalMSISecret) SetAuthenticationValues(spt *ServicePrincipalToken, values *url.Values) error {
+	return nil
+}
+
+// ServicePrincipalUsernamePasswordSecret implements ServicePrincipalSecret for the resource
+// owner password credentials grant.
+type ServicePrincipalUsernamePasswordSecret struct {
+	Username string
+	Password string
+}
+
+// SetAuthenticationValues sets the username and password parameters used by the password grant.
+func (secret *ServicePrincipalUsernamePasswordSecret) SetAuthenticationValues(spt *ServicePrincipalToken, values *url.Values) error {
+	values.Set("username", secret.Username)
+	values.Set("password", secret.Password)
+	return nil
+}
+
+// ServicePrincipalAuthorizationCodeSecret implements ServicePrincipalSecret for exchanging an
+// authorization code, obtained via an interactive sign-in, for a token.
+type ServicePrincipalAuthorizationCodeSecret struct {
+	ClientSecret      string
+	AuthorizationCode string
+	RedirectURI       string
+}
+
+// SetAuthenticationValues sets the client_secret, code, and redirect_uri parameters used by the
+// authorization code grant.
+func (secret *ServicePrincipalAuthorizationCodeSecret) SetAuthenticationValues(spt *ServicePrincipalToken, values *url.Values) error {
+	values.Set("client_secret", secret.ClientSecret)
+	values.Set("code", secret.AuthorizationCode)
+	values.Set("redirect_uri", secret.RedirectURI)
+	return nil
+}
+
+// TokenRefreshCallback is a type representing a callback function that is called after a
+// successful token refresh, such as to persist the refreshed Token to storage.
+type TokenRefreshCallback func(Token) error
+
 // ServicePrincipalToken encapsulates a Token created for a Service Principal.
 type ServicePrincipalToken struct {
-	Token
+	token Token
+
+	secret           ServicePrincipalSecret
+	oauthConfig      OAuthConfig
+	clientID         string
+	resource         string
+	autoRefresh      bool
+	refreshWithin    time.Duration
+	sender           autorest.Sender
+	refreshCallbacks []TokenRefreshCallback
 
-	clientId      string
-	clientSecret  string
-	resource      string
-	tenantId      string
-	autoRefresh   bool
-	refreshWithin time.Duration
-	sender        autorest.Sender
+	mu sync.Mutex
 }
 
-// NewTokenForServicePrincipal creates a ServicePrincipalToken from the supplied Service Principal
-// credentials scoped to the named resource.
-func NewServicePrincipalToken(id string, secret string, tenentId string, resource string) (*ServicePrincipalToken, error) {
+// NewServicePrincipalTokenWithSecret creates a ServicePrincipalToken that authenticates against
+// the token endpoint of the supplied OAuthConfig using the supplied ServicePrincipalSecret.
+func NewServicePrincipalTokenWithSecret(oauthConfig OAuthConfig, id string, resource string, secret ServicePrincipalSecret) (*ServicePrincipalToken, error) {
 	spt := &ServicePrincipalToken{
-		clientId:      id,
-		clientSecret:  secret,
+		oauthConfig:   oauthConfig,
+		secret:        secret,
+		clientID:      id,
 		resource:      resource,
-		tenantId:      tenentId,
 		autoRefresh:   true,
 		refreshWithin: defaultRefresh,
-		sender:        &http.Client{}}
+		sender:        &http.Client{},
+	}
+	return spt, nil
+}
+
+// NewServicePrincipalToken creates a ServicePrincipalToken from the supplied Service Principal
+// credentials scoped to the named resource, using the client credentials grant.
+func NewServicePrincipalToken(oauthConfig OAuthConfig, id string, secret string, resource string) (*ServicePrincipalToken, error) {
+	return NewServicePrincipalTokenWithSecret(oauthConfig, id, resource, &ServicePrincipalTokenSecret{ClientSecret: secret})
+}
+
+// NewServicePrincipalTokenFromCertificate creates a ServicePrincipalToken that authenticates
+// using a signed JWT client assertion built from the supplied certificate and private key.
+func NewServicePrincipalTokenFromCertificate(oauthConfig OAuthConfig, id string, certificate *x509.Certificate, privateKey *rsa.PrivateKey, resource string) (*ServicePrincipalToken, error) {
+	return NewServicePrincipalTokenWithSecret(oauthConfig, id, resource,
+		&ServicePrincipalCertificateSecret{
+			PrivateKey:  privateKey,
+			Certificate: certificate,
+		})
+}
+
+// NewServicePrincipalTokenFromManagedIdentity creates a ServicePrincipalToken that obtains its
+// token from the Azure Instance Metadata Service using the VM's managed identity.
+func NewServicePrincipalTokenFromManagedIdentity(resource string) (*ServicePrincipalToken, error) {
+	return NewServicePrincipalTokenWithSecret(OAuthConfig{}, "", resource, &ServicePrincipalMSISecret{})
+}
+
+// NewServicePrincipalTokenFromUsernamePassword creates a ServicePrincipalToken from the supplied
+// username and password, using the resource owner password credentials grant.
+func NewServicePrincipalTokenFromUsernamePassword(oauthConfig OAuthConfig, id string, username string, password string, resource string) (*ServicePrincipalToken, error) {
+	return NewServicePrincipalTokenWithSecret(oauthConfig, id, resource,
+		&ServicePrincipalUsernamePasswordSecret{
+			Username: username,
+			Password: password,
+		})
+}
+
+// NewServicePrincipalTokenFromAuthorizationCode creates a ServicePrincipalToken from the
+// supplied authorization code, exchanging it for a token via the authorization code grant.
+func NewServicePrincipalTokenFromAuthorizationCode(oauthConfig OAuthConfig, id string, clientSecret string, authorizationCode string, redirectURI string, resource string) (*ServicePrincipalToken, error) {
+	return NewServicePrincipalTokenWithSecret(oauthConfig, id, resource,
+		&ServicePrincipalAuthorizationCodeSecret{
+			ClientSecret:      clientSecret,
+			AuthorizationCode: authorizationCode,
+			RedirectURI:       redirectURI,
+		})
+}
+
+// DeviceCode carries the user-facing instructions and polling state for a device code
+// authentication flow started by InitiateDeviceAuth.
+type DeviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	ExpiresIn       string `json:"expires_in"`
+	Interval        string `json:"interval"`
+	Message         string `json:"message"`
+
+	oauthConfig OAuthConfig
+	clientID    string
+	resource    string
+}
+
+// errAuthorizationPending is returned by CheckForUserCompletion while the user has not yet
+// finished signing in at the DeviceCode's VerificationURL.
+var errAuthorizationPending = errors.New("azure: authorization pending, the user has not yet completed the device code sign-in")
+
+// InitiateDeviceAuth starts a device code authentication flow for the given client scoped to the
+// named resource, returning a DeviceCode whose UserCode and VerificationURL should be shown to
+// the user, and whose other fields WaitForUserCompletion needs to poll for completion.
+func InitiateDeviceAuth(sender autorest.Sender, oauthConfig OAuthConfig, clientID string, resource string) (*DeviceCode, error) {
+	v := url.Values{}
+	v.Set("client_id", clientID)
+	v.Set("resource", resource)
+
+	req, err := autorest.Prepare(&http.Request{},
+		autorest.AsPost(),
+		autorest.AsFormUrlEncoded(),
+		autorest.WithBaseURL(oauthConfig.DeviceCodeEndpoint.String()),
+		autorest.WithFormData(v))
+	if err != nil {
+		return nil, fmt.Errorf("azure: Failed to create device code request for client %s (%v)", clientID, err)
+	}
+
+	resp, err := autorest.SendWithSender(sender, req)
+	if err != nil {
+		return nil, fmt.Errorf("azure: Device code request for client %s failed (%v)", clientID, err)
+	}
+
+	var code DeviceCode
+	err = autorest.Respond(resp,
+		WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&code),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, fmt.Errorf("azure: Device code request for client %s returned an unexpected error (%v)", clientID, err)
+	}
+
+	code.oauthConfig = oauthConfig
+	code.clientID = clientID
+	code.resource = resource
+	return &code, nil
+}
+
+// CheckForUserCompletion polls the token endpoint once for the device code's completion,
+// returning errAuthorizationPending if the user has not yet finished signing in.
+func CheckForUserCompletion(sender autorest.Sender, code *DeviceCode) (*Token, error) {
+	v := url.Values{}
+	v.Set("client_id", code.clientID)
+	v.Set("code", code.DeviceCode)
+	v.Set("grant_type", "device_code")
+	v.Set("resource", code.resource)
+
+	req, err := autorest.Prepare(&http.Request{},
+		autorest.AsPost(),
+		autorest.AsFormUrlEncoded(),
+		autorest.WithBaseURL(code.oauthConfig.TokenEndpoint.String()),
+		autorest.WithFormData(v))
+	if err != nil {
+		return nil, fmt.Errorf("azure: Failed to create device code token request for client %s (%v)", code.clientID, err)
+	}
+
+	resp, err := autorest.SendWithSender(sender, req)
+	if err != nil {
+		return nil, fmt.Errorf("azure: Device code token request for client %s failed (%v)", code.clientID, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("azure: Failed to read device code token response for client %s (%v)", code.clientID, err)
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		var token Token
+		if err := json.Unmarshal(body, &token); err != nil {
+			return nil, fmt.Errorf("azure: Failed to unmarshal device code token response for client %s (%v)", code.clientID, err)
+		}
+		return &token, nil
+	}
+
+	// Unlike the nested ARM error envelope WithErrorUnlessStatusCode parses, AAD's device code
+	// polling errors are a flat {"error": "...", "error_description": "..."}, so they are handled
+	// directly here rather than via WithErrorUnlessStatusCode.
+	var tokenErr struct {
+		Error string `json:"error"`
+	}
+	if jsonErr := json.Unmarshal(body, &tokenErr); jsonErr == nil && tokenErr.Error == "authorization_pending" {
+		return nil, errAuthorizationPending
+	}
+	return nil, fmt.Errorf("azure: Device code token request for client %s failed with status %d (%s)", code.clientID, resp.StatusCode, body)
+}
+
+// WaitForUserCompletion polls the token endpoint for the device code's completion at the
+// interval AAD requested, blocking until the user finishes signing in or the flow fails for any
+// other reason.
+func WaitForUserCompletion(sender autorest.Sender, code *DeviceCode) (*Token, error) {
+	wait := 5 * time.Second
+	if i, err := strconv.Atoi(code.Interval); err == nil && i > 0 {
+		wait = time.Duration(i) * time.Second
+	}
+
+	for {
+		token, err := CheckForUserCompletion(sender, code)
+		if err == nil {
+			return token, nil
+		}
+		if err != errAuthorizationPending {
+			return nil, err
+		}
+		time.Sleep(wait)
+	}
+}
+
+// NewServicePrincipalTokenFromDeviceCode creates a ServicePrincipalToken from the Token obtained
+// by a completed device code flow (see InitiateDeviceAuth and WaitForUserCompletion). Like the
+// device code exchange itself, subsequent refreshes present no client secret to the token
+// endpoint.
+func NewServicePrincipalTokenFromDeviceCode(deviceCode DeviceCode, token Token) (*ServicePrincipalToken, error) {
+	spt, err := NewServicePrincipalTokenWithSecret(deviceCode.oauthConfig, deviceCode.clientID, deviceCode.resource, &ServicePrincipalNoSecret{})
+	if err != nil {
+		return nil, err
+	}
+	spt.token = token
 	return spt, nil
 }
 
 // EnsureFresh will refresh the token if it will expire within the refresh window (as set by
-// RefreshWithin).
+// RefreshWithin). It is safe to call concurrently; only one goroutine will actually perform the
+// refresh, the others will observe the refreshed Token once it is released.
 func (spt *ServicePrincipalToken) EnsureFresh() error {
-	if spt.WillExpireIn(spt.refreshWithin) {
-		return spt.Refresh()
+	spt.mu.Lock()
+	defer spt.mu.Unlock()
+	// Check only under the lock: another goroutine may have already refreshed the token while we
+	// were waiting to acquire it.
+	if spt.token.WillExpireIn(spt.refreshWithin) {
+		return spt.refresh()
 	}
 	return nil
 }
 
-// Refresh obtains a fresh token for the Service Principal.
+// Refresh obtains a fresh token for the Service Principal. It is safe to call concurrently.
 func (spt *ServicePrincipalToken) Refresh() error {
-	p := map[string]interface{}{
-		"tenantId":    spt.tenantId,
-		"requestType": "token",
+	spt.mu.Lock()
+	defer spt.mu.Unlock()
+	return spt.refresh()
+}
+
+// refresh performs the actual token acquisition and must be called with spt.mu held.
+func (spt *ServicePrincipalToken) refresh() error {
+	var err error
+	if _, ok := spt.secret.(*ServicePrincipalMSISecret); ok {
+		err = spt.refreshFromMSI()
+	} else {
+		err = spt.refreshInternal()
+	}
+	if err != nil {
+		return err
 	}
 
+	for _, callback := range spt.refreshCallbacks {
+		if err := callback(spt.token); err != nil {
+			return fmt.Errorf("azure: TokenRefreshCallback returned an error for Service Principal %s (%v)", spt.clientID, err)
+		}
+	}
+	return nil
+}
+
+// SetRefreshCallbacks replaces any existing refresh callbacks with the supplied ones. Each is
+// invoked, in order, after every successful token refresh so that callers can persist tokens to
+// disk, emit metrics, or invalidate caches.
+func (spt *ServicePrincipalToken) SetRefreshCallbacks(callbacks []TokenRefreshCallback) {
+	spt.refreshCallbacks = callbacks
+}
+
+// OAuthToken returns the current access token, taking the lock so it is safe to call while a
+// refresh may be in progress on another goroutine.
+func (spt *ServicePrincipalToken) OAuthToken() string {
+	spt.mu.Lock()
+	defer spt.mu.Unlock()
+	return spt.token.AccessToken
+}
+
+// Token returns a copy of the current Token, taking the lock so it is safe to call while a
+// refresh may be in progress on another goroutine.
+func (spt *ServicePrincipalToken) Token() Token {
+	spt.mu.Lock()
+	defer spt.mu.Unlock()
+	return spt.token
+}
+
+func (spt *ServicePrincipalToken) refreshInternal() error {
 	v := url.Values{}
-	v.Set("client_id", spt.clientId)
-	v.Set("client_secret", spt.clientSecret)
-	v.Set("grant_type", "client_credentials")
+	v.Set("client_id", spt.clientID)
 	v.Set("resource", spt.resource)
 
+	switch {
+	case spt.token.RefreshToken != "":
+		v.Set("grant_type", "refresh_token")
+		v.Set("refresh_token", spt.token.RefreshToken)
+	default:
+		v.Set("grant_type", grantTypeFor(spt.secret))
+	}
+
+	if spt.secret != nil {
+		if err := spt.secret.SetAuthenticationValues(spt, &v); err != nil {
+			return fmt.Errorf("azure: Failed to build refresh request values for Service Principal %s (%v)", spt.clientID, err)
+		}
+	}
+
 	req, err := autorest.Prepare(&http.Request{},
 		autorest.AsPost(),
 		autorest.AsFormUrlEncoded(),
-		autorest.WithBaseURL(oauthUrl),
-		autorest.WithPathParameters(p),
+		autorest.WithBaseURL(spt.oauthConfig.TokenEndpoint.String()),
 		autorest.WithFormData(v))
 	if err != nil {
-		return fmt.Errorf("azure: Failed to create refresh request for Service Principal %s (%v)", spt.clientId, err)
+		return fmt.Errorf("azure: Failed to create refresh request for Service Principal %s (%v)", spt.clientID, err)
+	}
+
+	resp, err := autorest.SendWithSender(spt.sender, req)
+	if err != nil {
+		return fmt.Errorf("azure: Token request for Service Principal %s failed (%v)", spt.clientID, err)
+	}
+
+	var newToken Token
+	err = autorest.Respond(resp,
+		WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&newToken),
+		autorest.ByClosing())
+	if err != nil {
+		return fmt.Errorf("azure: Token request for Service Principal %s returned an unexpected error (%v)", spt.clientID, err)
 	}
 
+	spt.token = newToken
+	return nil
+}
+
+func (spt *ServicePrincipalToken) refreshFromMSI() error {
+	req, err := autorest.Prepare(&http.Request{},
+		autorest.AsGet(),
+		autorest.WithBaseURL(msiEndpoint),
+		autorest.WithQueryParameters(map[string]interface{}{
+			"api-version": "2018-02-01",
+			"resource":    spt.resource,
+		}))
+	if err != nil {
+		return fmt.Errorf("azure: Failed to create MSI refresh request (%v)", err)
+	}
+	req.Header.Set("Metadata", "true")
+
 	resp, err := autorest.SendWithSender(spt.sender, req)
 	if err != nil {
-		return fmt.Errorf("azure: Token request for Service Principal %s failed (%v)", spt.clientId, err)
+		return fmt.Errorf("azure: MSI token request failed (%v)", err)
 	}
 
+	var newToken Token
 	err = autorest.Respond(resp,
-		autorest.WithErrorUnlessOK(),
-		autorest.ByUnmarshallingJSON(spt),
+		WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&newToken),
 		autorest.ByClosing())
 	if err != nil {
-		return fmt.Errorf("azure: Token request for Service Principal %s returned an unexpected error (%v)", spt.clientId, err)
+		return fmt.Errorf("azure: MSI token request returned an unexpected error (%v)", err)
 	}
 
+	spt.token = newToken
 	return nil
 }
 
+// grantTypeFor returns the OAuth grant_type implied by the kind of secret in use.
+func grantTypeFor(secret ServicePrincipalSecret) string {
+	switch secret.(type) {
+	case *ServicePrincipalUsernamePasswordSecret:
+		return "password"
+	case *ServicePrincipalAuthorizationCodeSecret:
+		return "authorization_code"
+	default:
+		return "client_credentials"
+	}
+}
+
 // SetAutoRefresh enables or disables automatic refreshing of stale tokens.
 func (spt *ServicePrincipalToken) SetAutoRefresh(autoRefresh bool) {
 	spt.autoRefresh = autoRefresh
@@ -172,7 +668,7 @@ func (spt *ServicePrincipalToken) WithAuthorization() autorest.PrepareDecorator
 					return r, fmt.Errorf("azure: Failed to refresh Service Principal Token for request to %s (%v)", r.URL, err)
 				}
 			}
-			return (autorest.WithBearerAuthorization(spt.AccessToken)(p)).Prepare(r)
+			return (autorest.WithBearerAuthorization(spt.OAuthToken())(p)).Prepare(r)
 		})
 	}
 }
@@ -0,0 +1,70 @@
+package azure
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// fakeTokenSender is an autorest.Sender that answers every request with a fixed 200 response
+// carrying a JSON token body, standing in for the AAD token endpoint so tests never make a real
+// network call.
+type fakeTokenSender struct {
+	body string
+}
+
+func (f fakeTokenSender) Do(*http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(f.body)),
+		Header:     http.Header{},
+	}, nil
+}
+
+// TestServicePrincipalToken_ConcurrentRefresh exercises EnsureFresh, Refresh, and the
+// OAuthToken/Token accessors from many goroutines at once. Run with -race: a data race here
+// means spt.token is being read and written without spt.mu held.
+func TestServicePrincipalToken_ConcurrentRefresh(t *testing.T) {
+	spt, err := NewServicePrincipalToken(OAuthConfig{}, "client-id", "secret", "resource")
+	if err != nil {
+		t.Fatalf("NewServicePrincipalToken: %v", err)
+	}
+	spt.SetSender(fakeTokenSender{body: `{"access_token":"token","expires_on":"99999999999"}`})
+
+	var callbackCalls int32
+	var mu sync.Mutex
+	spt.SetRefreshCallbacks([]TokenRefreshCallback{
+		func(Token) error {
+			mu.Lock()
+			callbackCalls++
+			mu.Unlock()
+			return nil
+		},
+	})
+
+	const goroutines = 20
+	var wg sync.WaitGroup
+	wg.Add(goroutines * 3)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			if err := spt.EnsureFresh(); err != nil {
+				t.Errorf("EnsureFresh: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := spt.Refresh(); err != nil {
+				t.Errorf("Refresh: %v", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_ = spt.OAuthToken()
+			_ = spt.Token()
+		}()
+	}
+	wg.Wait()
+}